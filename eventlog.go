@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// EventType identifies the kind of change a todo went through.
+type EventType string
+
+const (
+	EventCreated   EventType = "todo.created"
+	EventUpdated   EventType = "todo.updated"
+	EventCompleted EventType = "todo.completed"
+	EventDeleted   EventType = "todo.deleted"
+)
+
+// Event is a single append-only record describing a change to a todo.
+// A full replay of the log, in order, rebuilds the store's state.
+type Event struct {
+	Type    EventType  `json:"type"`
+	ID      string     `json:"id"`
+	OwnerID string     `json:"ownerId"`
+	Todo    *todoModel `json:"todo,omitempty"`
+	At      time.Time  `json:"at"`
+}
+
+// EventLog appends todo events and replays them back in order.
+type EventLog interface {
+	Append(ctx context.Context, e Event) error
+	Replay(ctx context.Context, apply func(Event) error) error
+}
+
+// newEventLog builds the EventLog selected by EVENT_LOG (redis|file|""),
+// returning (nil, nil) when event sourcing isn't enabled.
+func newEventLog(ctx context.Context, redisAddr string) (EventLog, error) {
+	switch os.Getenv("EVENT_LOG") {
+	case "redis":
+		return NewRedisStreamLog(ctx, redisAddr)
+	case "file":
+		path := os.Getenv("EVENT_LOG_PATH")
+		if path == "" {
+			path = "todo-events.jsonl"
+		}
+		return NewFileEventLog(path), nil
+	default:
+		return nil, nil
+	}
+}
+
+// RedisStreamLog appends events to a Redis stream.
+type RedisStreamLog struct {
+	client *redis.Client
+	stream string
+}
+
+const defaultEventStream = "events:todo"
+
+// NewRedisStreamLog connects to addr and uses the default "events:todo" stream.
+func NewRedisStreamLog(ctx context.Context, addr string) (*RedisStreamLog, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+	return &RedisStreamLog{client: client, stream: defaultEventStream}, nil
+}
+
+func (l *RedisStreamLog) Append(ctx context.Context, e Event) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return l.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: l.stream,
+		Values: map[string]interface{}{"event": raw},
+	}).Err()
+}
+
+func (l *RedisStreamLog) Replay(ctx context.Context, apply func(Event) error) error {
+	msgs, err := l.client.XRange(ctx, l.stream, "-", "+").Result()
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range msgs {
+		raw, ok := msg.Values["event"].(string)
+		if !ok {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal([]byte(raw), &e); err != nil {
+			return err
+		}
+		if err := apply(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileEventLog appends newline-delimited JSON events to a local file.
+type FileEventLog struct {
+	path string
+}
+
+// NewFileEventLog targets the given path, creating it lazily on first Append.
+func NewFileEventLog(path string) *FileEventLog {
+	return &FileEventLog{path: path}
+}
+
+func (l *FileEventLog) Append(ctx context.Context, e Event) error {
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(raw, '\n'))
+	return err
+}
+
+func (l *FileEventLog) Replay(ctx context.Context, apply func(Event) error) error {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return err
+		}
+		if err := apply(e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// EventSourcedStore layers an EventLog on top of a TodoStore: every write
+// is recorded after it succeeds, and on construction the underlying store
+// is rebuilt by replaying the log.
+type EventSourcedStore struct {
+	TodoStore
+	log EventLog
+}
+
+// NewEventSourcedStore replays log into store and returns a TodoStore that
+// keeps recording further writes to log.
+func NewEventSourcedStore(ctx context.Context, store TodoStore, log EventLog) (*EventSourcedStore, error) {
+	s := &EventSourcedStore{TodoStore: store, log: log}
+
+	err := log.Replay(ctx, func(e Event) error {
+		switch e.Type {
+		case EventCreated, EventUpdated, EventCompleted:
+			if e.Todo == nil {
+				return nil
+			}
+			if _, err := store.Get(ctx, e.OwnerID, e.ID); err == ErrNotFound {
+				return store.Create(ctx, e.Todo)
+			}
+			return store.Update(ctx, e.OwnerID, e.ID, e.Todo, 0)
+		case EventDeleted:
+			err := store.Delete(ctx, e.OwnerID, e.ID, 0)
+			if err == ErrNotFound {
+				return nil
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *EventSourcedStore) Create(ctx context.Context, t *todoModel) error {
+	if err := s.TodoStore.Create(ctx, t); err != nil {
+		return err
+	}
+	return s.log.Append(ctx, Event{Type: EventCreated, ID: t.ID, OwnerID: t.OwnerID, Todo: t, At: time.Now()})
+}
+
+func (s *EventSourcedStore) Update(ctx context.Context, ownerID, id string, t *todoModel, expectedVersion int) error {
+	if err := s.TodoStore.Update(ctx, ownerID, id, t, expectedVersion); err != nil {
+		return err
+	}
+
+	evt := EventUpdated
+	if t.Status == StatusDone {
+		evt = EventCompleted
+	}
+	return s.log.Append(ctx, Event{Type: evt, ID: id, OwnerID: ownerID, Todo: t, At: time.Now()})
+}
+
+func (s *EventSourcedStore) Delete(ctx context.Context, ownerID, id string, expectedVersion int) error {
+	if err := s.TodoStore.Delete(ctx, ownerID, id, expectedVersion); err != nil {
+		return err
+	}
+	return s.log.Append(ctx, Event{Type: EventDeleted, ID: id, OwnerID: ownerID, At: time.Now()})
+}
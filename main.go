@@ -3,23 +3,21 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/thedevsaddam/renderer"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"gopkg.in/mgo.v2/bson"
 )
 
 var rnd *renderer.Render
-var collection *mongo.Collection
-var ctx = context.TODO()
+var store TodoStore
 
 const (
 	hostName       string = "localhost:27017"
@@ -28,207 +26,330 @@ const (
 	port           string = ":9000"
 )
 
+// TodoStatus is the lifecycle state of a todo, replacing the old
+// Completed bool with something that can represent in-progress work.
+type TodoStatus string
+
+const (
+	StatusPending    TodoStatus = "pending"
+	StatusInProgress TodoStatus = "in_progress"
+	StatusDone       TodoStatus = "done"
+)
+
 type (
 	todoModel struct {
-		ID        bson.ObjectId `bson:"_id,omitempty"`
-		Title     string        `bson:"title"`
-		Completed bool          `bson:"completed"`
-		CreatedAt time.Time     `bson:"createdAt"`
+		ID        string     `bson:"_id,omitempty" json:"id"`
+		OwnerID   string     `bson:"ownerId" json:"ownerId"`
+		Title     string     `bson:"title" json:"title"`
+		Body      string     `bson:"body" json:"body"`
+		Status    TodoStatus `bson:"status" json:"status"`
+		Tags      []string   `bson:"tags" json:"tags"`
+		DueAt     *time.Time `bson:"dueAt,omitempty" json:"dueAt,omitempty"`
+		Version   int        `bson:"version" json:"version"`
+		CreatedAt time.Time  `bson:"createdAt" json:"createdAt"`
+		UpdatedAt time.Time  `bson:"updatedAt" json:"updatedAt"`
 	}
 	todo struct {
-		ID        string    `json:"id"`
-		Title     string    `json:"title"`
-		Completed bool      `json:"completed"`
-		CreatedAt time.Time `json:"createdAt"`
+		ID        string     `json:"id"`
+		OwnerID   string     `json:"ownerId"`
+		Title     string     `json:"title"`
+		Body      string     `json:"body"`
+		Status    TodoStatus `json:"status"`
+		Tags      []string   `json:"tags"`
+		DueAt     *time.Time `json:"dueAt,omitempty"`
+		Version   int        `json:"version"`
+		CreatedAt time.Time  `json:"createdAt"`
+		UpdatedAt time.Time  `json:"updatedAt"`
 	}
 )
 
-func init() {
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
-	client, err := mongo.Connect(ctx, clientOptions)
+func homeHandler(w http.ResponseWriter, r *http.Request) {
+	err := rnd.Template(w, http.StatusOK, []string{"static/home.tpl"}, nil)
+	checkErr(err)
+}
 
+func fetchTodos(w http.ResponseWriter, r *http.Request) {
+	f, err := parseTodoFilter(r)
 	if err != nil {
-		log.Fatal(err)
+		writeProblem(w, http.StatusBadRequest, "validation", "Invalid query parameters", err.Error())
+		return
 	}
+	f.OwnerID = userIDFromContext(r.Context())
 
-	err = client.Ping(ctx, nil)
+	ctx, cancel := context.WithTimeout(r.Context(), dbOpTimeout())
+	defer cancel()
+
+	res, err := store.List(ctx, f)
 	if err != nil {
-		log.Fatal(err)
+		storeErrorProblem(w, err)
+		return
 	}
 
-	collection = (client.Database(dbName).Collection(collectionName))
-}
+	todoList := []todo{}
+	for _, t := range res.Todos {
+		todoList = append(todoList, toTodo(t))
+	}
 
-func homeHandler(w http.ResponseWriter, r *http.Request) {
-	err := rnd.Template(w, http.StatusOK, []string{"static/home.tpl"}, nil)
-	checkErr(err)
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data":        todoList,
+		"next_cursor": res.NextCursor,
+		"total":       res.Total,
+	})
 }
 
-func fetchTodos(w http.ResponseWriter, r *http.Request) {
-	todos := []todoModel{}
+// getTodo handles GET /todo/{id}, setting the ETag header so clients can
+// make conditional writes via If-Match.
+func getTodo(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
 
-	fetch, err := collection.Find(ctx, bson.M{})
+	ctx, cancel := context.WithTimeout(r.Context(), dbOpTimeout())
+	defer cancel()
 
+	t, err := store.Get(ctx, userIDFromContext(r.Context()), id)
 	if err != nil {
-		rnd.JSON(w, http.StatusProcessing, renderer.M{
-			"message": "Failed to fetch todos",
-			"error":   err,
-		})
+		storeErrorProblem(w, err)
 		return
 	}
-	defer fetch.Close(ctx)
 
-	for fetch.Next(ctx) {
-		var t todoModel
-		err := fetch.Decode(&t)
+	w.Header().Set("ETag", computeETag(t.Version))
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"data": toTodo(t),
+	})
+}
+
+func toTodo(t todoModel) todo {
+	return todo{
+		ID:        t.ID,
+		OwnerID:   t.OwnerID,
+		Title:     t.Title,
+		Body:      t.Body,
+		Status:    t.Status,
+		Tags:      t.Tags,
+		DueAt:     t.DueAt,
+		Version:   t.Version,
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+	}
+}
+
+// parseTodoFilter translates the GET /todo query string into a TodoFilter.
+func parseTodoFilter(r *http.Request) (TodoFilter, error) {
+	q := r.URL.Query()
+	f := TodoFilter{
+		Tag:    q.Get("tag"),
+		Query:  q.Get("q"),
+		Sort:   q.Get("sort"),
+		Cursor: q.Get("cursor"),
+	}
+
+	if v := q.Get("completed"); v != "" {
+		b, err := strconv.ParseBool(v)
 		if err != nil {
-			rnd.JSON(w, http.StatusProcessing, renderer.M{
-				"message": "Failed to fetch todos",
-				"error":   err,
-			})
-			return
+			return TodoFilter{}, errors.New("completed must be true or false")
 		}
-		todos = append(todos, t)
+		f.Completed = &b
 	}
 
-	if err := fetch.Err(); err != nil {
-		rnd.JSON(w, http.StatusProcessing, renderer.M{
-			"message": "Failed to fetch todos",
-			"error":   err,
-		})
-		return
+	if v := q.Get("due_before"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return TodoFilter{}, errors.New("due_before must be RFC3339")
+		}
+		f.DueBefore = &t
 	}
 
-	todoList := []todo{}
-
-	for _, t := range todos {
-		todoList = append(todoList, todo{
-			ID:        t.ID.Hex(),
-			Title:     t.Title,
-			Completed: t.Completed,
-			CreatedAt: t.CreatedAt,
-		})
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return TodoFilter{}, errors.New("limit must be a positive integer")
+		}
+		f.Limit = n
 	}
-	rnd.JSON(w, http.StatusOK, renderer.M{
-		"data": todoList,
-	})
+
+	return f, nil
 }
 
 func createTodo(w http.ResponseWriter, r *http.Request) {
 	var t todo
 
 	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
-		rnd.JSON(w, http.StatusProcessing, err)
+		writeProblem(w, http.StatusBadRequest, "validation", "Malformed request body", err.Error())
 		return
 	}
 
 	if t.Title == "" {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "The title is required",
-		})
+		writeProblem(w, http.StatusBadRequest, "validation", "The title is required", "")
 		return
 	}
 
+	if t.DueAt != nil && !t.DueAt.After(time.Now()) {
+		writeProblem(w, http.StatusBadRequest, "validation", "dueAt must be in the future", "")
+		return
+	}
+
+	status := t.Status
+	if status == "" {
+		status = StatusPending
+	}
+
+	now := time.Now()
 	tm := todoModel{
-		ID:        bson.NewObjectId(),
+		OwnerID:   userIDFromContext(r.Context()),
 		Title:     t.Title,
-		Completed: false,
-		CreatedAt: time.Now(),
+		Body:      t.Body,
+		Status:    status,
+		Tags:      t.Tags,
+		DueAt:     t.DueAt,
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
-	if _, err := collection.InsertOne(ctx, &tm); err != nil {
-		rnd.JSON(w, http.StatusProcessing, renderer.M{
-			"message": "Failed to save todo",
-			"error":   err,
-		})
+	ctx, cancel := context.WithTimeout(r.Context(), dbOpTimeout())
+	defer cancel()
+
+	if err := store.Create(ctx, &tm); err != nil {
+		storeErrorProblem(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", computeETag(tm.Version))
 	rnd.JSON(w, http.StatusCreated, renderer.M{
 		"message": "Todo created successfully",
-		"todo_id": tm.ID.Hex(),
+		"todo_id": tm.ID,
 	})
+
+	created := toTodo(tm)
+	broker.Publish(changeEvent{Op: "created", ID: tm.ID, OwnerID: tm.OwnerID, Todo: &created})
+}
+
+// requireIfMatch reads and parses the If-Match header, writing the
+// appropriate error response itself when the header is missing or
+// malformed. ok is false if the caller should stop handling the request.
+func requireIfMatch(w http.ResponseWriter, r *http.Request) (version int, ok bool) {
+	etag := r.Header.Get("If-Match")
+	if etag == "" {
+		writeProblem(w, http.StatusPreconditionRequired, "precondition_required", "The If-Match header is required", "")
+		return 0, false
+	}
+
+	version, err := parseETag(etag)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "validation", "Malformed If-Match header", err.Error())
+		return 0, false
+	}
+
+	return version, true
 }
 
 func deleteTodo(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-    if !bson.IsObjectIdHex(id) {
-        rnd.JSON(w, http.StatusBadRequest, renderer.M{
-            "message": "Invalid todo ID",
-        })
-        return
-    }
-
-    objID := bson.ObjectIdHex(id)
-    filter := bson.M{"_id": objID}
-
-    if _, err := collection.DeleteOne(ctx, filter, nil); err != nil {
-        rnd.JSON(w, http.StatusProcessing, renderer.M{
-            "message": "Failed to delete todo",
-            "error":   err,
-        })
-        return
-    }
-
-    rnd.JSON(w, http.StatusOK, renderer.M{
-        "message": "Todo deleted successfully",
-    })
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	ownerID := userIDFromContext(r.Context())
+
+	ctx, cancel := context.WithTimeout(r.Context(), dbOpTimeout())
+	defer cancel()
+
+	if err := store.Delete(ctx, ownerID, id, version); err != nil {
+		storeErrorProblem(w, err)
+		return
+	}
+
+	rnd.JSON(w, http.StatusOK, renderer.M{
+		"message": "Todo deleted successfully",
+	})
+	broker.Publish(changeEvent{Op: "deleted", ID: id, OwnerID: ownerID})
 }
 
 func updateTodo(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "The todo ID is required",
-		})
+		writeProblem(w, http.StatusBadRequest, "validation", "The todo ID is required", "")
 		return
 	}
 
 	var t todo
 
 	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
-		rnd.JSON(w, http.StatusProcessing, err)
+		writeProblem(w, http.StatusBadRequest, "validation", "Malformed request body", err.Error())
 		return
 	}
 
 	if t.Title == "" {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "The title is required",
-		})
+		writeProblem(w, http.StatusBadRequest, "validation", "The title is required", "")
 		return
 	}
 
-	filter := bson.M{"_id": bson.ObjectIdHex(id)}
-	update := bson.M{
-		"$set": bson.M{
-			"title":     t.Title,
-			"completed": t.Completed,
-		},
+	if t.DueAt != nil && !t.DueAt.After(time.Now()) {
+		writeProblem(w, http.StatusBadRequest, "validation", "dueAt must be in the future", "")
+		return
 	}
 
-	_, err := collection.UpdateOne(ctx, filter, update)
-	if err != nil {
-		rnd.JSON(w, http.StatusProcessing, renderer.M{
-			"message": "Failed to update todo",
-			"error":   err,
-		})
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	tm := todoModel{
+		Title:     t.Title,
+		Body:      t.Body,
+		Status:    t.Status,
+		Tags:      t.Tags,
+		DueAt:     t.DueAt,
+		UpdatedAt: time.Now(),
+	}
+
+	ownerID := userIDFromContext(r.Context())
+
+	ctx, cancel := context.WithTimeout(r.Context(), dbOpTimeout())
+	defer cancel()
+
+	if err := store.Update(ctx, ownerID, id, &tm, version); err != nil {
+		storeErrorProblem(w, err)
 		return
 	}
 
+	tm.ID = id
+	tm.OwnerID = ownerID
+
+	w.Header().Set("ETag", computeETag(tm.Version))
 	rnd.JSON(w, http.StatusOK, renderer.M{
 		"message": "Todo successfully updated",
 	})
+
+	updated := toTodo(tm)
+	broker.Publish(changeEvent{Op: "updated", ID: id, OwnerID: ownerID, Todo: &updated})
 }
 
 func main() {
 	rnd = renderer.New()
 
+	ctx, cancel := context.WithTimeout(context.Background(), dbOpTimeout())
+	s, err := newStore(ctx)
+	cancel()
+	if err != nil {
+		log.Fatal(err)
+	}
+	store = s
+
+	if w, ok := store.(Watchable); ok {
+		go func() {
+			if err := w.Watch(context.Background(), broker.Publish); err != nil {
+				log.Printf("change stream: %v", err)
+			}
+		}()
+	}
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Get("/", homeHandler)
 
+	r.Mount("/auth", authHandlers())
 	r.Mount("/todo", todoHandlers())
 
 	srv := http.Server{
@@ -249,17 +370,21 @@ func main() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	<-c
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	srv.Shutdown(ctx)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	srv.Shutdown(shutdownCtx)
 	log.Println("Server gracefully stopped!")
 	os.Exit(0)
 }
 
 func todoHandlers() http.Handler {
 	rg := chi.NewRouter()
+	rg.Use(authMiddleware)
 	rg.Group(func(r chi.Router) {
 		r.Get("/", fetchTodos)
+		r.Get("/stream", sseHandler)
+		r.Get("/ws", wsHandler)
+		r.Get("/{id}", getTodo)
 		r.Post("/", createTodo)
 		r.Put("/{id}", updateTodo)
 		r.Delete("/{id}", deleteTodo)
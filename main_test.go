@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+)
+
+// TestMain sets up rnd, which main() would otherwise initialize before
+// any handler runs; tests call handlers directly, bypassing main().
+func TestMain(m *testing.M) {
+	rnd = renderer.New()
+	os.Exit(m.Run())
+}
+
+func TestWriteProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeProblem(w, http.StatusBadRequest, "validation", "The title is required", "")
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("Content-Type = %q, want application/problem+json", ct)
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	var p problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if p.Type != problemBaseURI+"validation" {
+		t.Errorf("type = %q, want %q", p.Type, problemBaseURI+"validation")
+	}
+	if p.Status != http.StatusBadRequest {
+		t.Errorf("status field = %d, want %d", p.Status, http.StatusBadRequest)
+	}
+}
+
+func TestStoreErrorProblemMapsCancellation(t *testing.T) {
+	w := httptest.NewRecorder()
+	storeErrorProblem(w, context.Canceled)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	var p problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if p.Type != problemBaseURI+"db_unavailable" {
+		t.Errorf("type = %q, want %q", p.Type, problemBaseURI+"db_unavailable")
+	}
+}
+
+// TestGetTodoAbortsOnClientCancellation simulates a client that has gone
+// away before the handler's store call runs: the request context is
+// already canceled, so the timeout derived from it in getTodo is too,
+// and the in-flight store operation must abort rather than proceed.
+func TestGetTodoAbortsOnClientCancellation(t *testing.T) {
+	mem := NewMemoryStore()
+	tm := &todoModel{OwnerID: "user-1", Title: "write the RFC 7807 doc"}
+	if err := mem.Create(context.Background(), tm); err != nil {
+		t.Fatalf("seed Create: %v", err)
+	}
+
+	prevStore := store
+	store = mem
+	defer func() { store = prevStore }()
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/todo/"+tm.ID, nil).WithContext(canceledCtx)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", tm.ID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	getTodo(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d (body: %s)", w.Code, http.StatusServiceUnavailable, w.Body.String())
+	}
+
+	var p problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if p.Type != problemBaseURI+"db_unavailable" {
+		t.Errorf("type = %q, want %q", p.Type, problemBaseURI+"db_unavailable")
+	}
+}
+
+// putTodoRequest builds a PUT /todo/{id} request carrying body and
+// ifMatch, wired up the way chi and authMiddleware would leave it:
+// route params in context and ownerID already resolved from the token.
+func putTodoRequest(id, ownerID, ifMatch, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPut, "/todo/"+id, strings.NewReader(body))
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), ctxUserIDKey, ownerID))
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+// TestUpdateTodoRejectsStaleIfMatch covers the optimistic-concurrency
+// path chunk0-3 added: a PUT carrying an If-Match for a version that's
+// no longer current must fail with 412, not silently overwrite it.
+func TestUpdateTodoRejectsStaleIfMatch(t *testing.T) {
+	mem := NewMemoryStore()
+	tm := &todoModel{OwnerID: "user-1", Title: "original"}
+	if err := mem.Create(context.Background(), tm); err != nil {
+		t.Fatalf("seed Create: %v", err)
+	}
+	staleVersion := tm.Version
+	bumped := &todoModel{Title: "bumped"}
+	if err := mem.Update(context.Background(), "user-1", tm.ID, bumped, staleVersion); err != nil {
+		t.Fatalf("seed Update: %v", err)
+	}
+
+	prevStore := store
+	store = mem
+	defer func() { store = prevStore }()
+
+	req := putTodoRequest(tm.ID, "user-1", computeETag(staleVersion), `{"title":"new title"}`)
+	w := httptest.NewRecorder()
+	updateTodo(w, req)
+
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("status = %d, want %d (body: %s)", w.Code, http.StatusPreconditionFailed, w.Body.String())
+	}
+
+	got, err := mem.Get(context.Background(), "user-1", tm.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Title != "bumped" {
+		t.Errorf("title = %q, want unchanged %q", got.Title, "bumped")
+	}
+}
+
+// TestUpdateTodoRejectsZeroIfMatch guards against If-Match: "0" being
+// treated as expectedVersion == 0, the stores' internal escape hatch
+// that skips the version check entirely (store.go's documented
+// contract for event replay) — a client must not be able to reach it.
+func TestUpdateTodoRejectsZeroIfMatch(t *testing.T) {
+	mem := NewMemoryStore()
+	tm := &todoModel{OwnerID: "user-1", Title: "original"}
+	if err := mem.Create(context.Background(), tm); err != nil {
+		t.Fatalf("seed Create: %v", err)
+	}
+
+	prevStore := store
+	store = mem
+	defer func() { store = prevStore }()
+
+	req := putTodoRequest(tm.ID, "user-1", `"0"`, `{"title":"new title"}`)
+	w := httptest.NewRecorder()
+	updateTodo(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d (body: %s)", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+
+	got, err := mem.Get(context.Background(), "user-1", tm.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Title != "original" {
+		t.Errorf("If-Match: \"0\" bypassed the version check; title = %q, want unchanged %q", got.Title, "original")
+	}
+}
+
+// TestFetchTodosScopesToOwner covers chunk0-4's ownership requirement:
+// list queries must never leak another user's todos.
+func TestFetchTodosScopesToOwner(t *testing.T) {
+	mem := NewMemoryStore()
+	for _, tm := range []*todoModel{
+		{OwnerID: "user-1", Title: "mine"},
+		{OwnerID: "user-2", Title: "not mine"},
+	} {
+		if err := mem.Create(context.Background(), tm); err != nil {
+			t.Fatalf("seed Create: %v", err)
+		}
+	}
+
+	prevStore := store
+	store = mem
+	defer func() { store = prevStore }()
+
+	req := httptest.NewRequest(http.MethodGet, "/todo", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ctxUserIDKey, "user-1"))
+
+	w := httptest.NewRecorder()
+	fetchTodos(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body: %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var resp struct {
+		Data []todo `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+
+	if len(resp.Data) != 1 {
+		t.Fatalf("data = %+v, want exactly user-1's one todo", resp.Data)
+	}
+	for _, td := range resp.Data {
+		if td.OwnerID != "user-1" {
+			t.Errorf("fetchTodos leaked a todo owned by %q into user-1's list", td.OwnerID)
+		}
+	}
+}
+
+// TestGetTodoRejectsOtherOwner covers the single-resource side of the
+// same requirement: a todo owned by another user must 404, not 200.
+func TestGetTodoRejectsOtherOwner(t *testing.T) {
+	mem := NewMemoryStore()
+	tm := &todoModel{OwnerID: "user-2", Title: "not yours"}
+	if err := mem.Create(context.Background(), tm); err != nil {
+		t.Fatalf("seed Create: %v", err)
+	}
+
+	prevStore := store
+	store = mem
+	defer func() { store = prevStore }()
+
+	req := httptest.NewRequest(http.MethodGet, "/todo/"+tm.ID, nil)
+	req = req.WithContext(context.WithValue(req.Context(), ctxUserIDKey, "user-1"))
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", tm.ID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	getTodo(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d (body: %s)", w.Code, http.StatusNotFound, w.Body.String())
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MemoryStore is an in-process TodoStore, mainly useful for local
+// development and tests where running Mongo or Redis isn't worth it.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	todos map[string]todoModel
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{todos: make(map[string]todoModel)}
+}
+
+func (s *MemoryStore) List(ctx context.Context, f TodoFilter) (ListResult, error) {
+	if err := ctx.Err(); err != nil {
+		return ListResult{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todos := []todoModel{}
+	for _, t := range s.todos {
+		todos = append(todos, t)
+	}
+	return paginateTodos(filterTodos(todos, f), f), nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, ownerID, id string) (todoModel, error) {
+	if err := ctx.Err(); err != nil {
+		return todoModel{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.todos[id]
+	if !ok || t.OwnerID != ownerID {
+		return todoModel{}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (s *MemoryStore) Create(ctx context.Context, t *todoModel) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t.ID == "" {
+		t.ID = bson.NewObjectId().Hex()
+	}
+	t.Version = 1
+	s.todos[t.ID] = *t
+	return nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, ownerID, id string, t *todoModel, expectedVersion int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.todos[id]
+	if !ok || existing.OwnerID != ownerID {
+		return ErrNotFound
+	}
+	if expectedVersion > 0 && existing.Version != expectedVersion {
+		return ErrConflict
+	}
+
+	t.ID = id
+	t.OwnerID = ownerID
+	t.CreatedAt = existing.CreatedAt
+	t.Version = existing.Version + 1
+	s.todos[id] = *t
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, ownerID, id string, expectedVersion int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.todos[id]
+	if !ok || existing.OwnerID != ownerID {
+		return ErrNotFound
+	}
+	if expectedVersion > 0 && existing.Version != expectedVersion {
+		return ErrConflict
+	}
+	delete(s.todos, id)
+	return nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MongoStore is the original TodoStore backend, backed by a MongoDB
+// collection.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStore connects to uri and returns a MongoStore ready to use.
+func NewMongoStore(ctx context.Context, uri string) (*MongoStore, error) {
+	clientOptions := options.Client().ApplyURI(uri)
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Ping(ctx, nil); err != nil {
+		return nil, err
+	}
+
+	return &MongoStore{
+		collection: client.Database(dbName).Collection(collectionName),
+	}, nil
+}
+
+func (s *MongoStore) List(ctx context.Context, f TodoFilter) (ListResult, error) {
+	query := bson.M{}
+	if f.OwnerID != "" {
+		query["ownerId"] = f.OwnerID
+	}
+	if f.Completed != nil {
+		if *f.Completed {
+			query["status"] = StatusDone
+		} else {
+			query["status"] = bson.M{"$ne": StatusDone}
+		}
+	}
+	if f.Tag != "" {
+		query["tags"] = f.Tag
+	}
+	if f.Query != "" {
+		query["title"] = bson.M{"$regex": f.Query, "$options": "i"}
+	}
+	if f.DueBefore != nil {
+		query["dueAt"] = bson.M{"$lt": *f.DueBefore}
+	}
+
+	total, err := s.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	sortField := "createdAt"
+	if f.Sort == "dueAt" {
+		sortField = "dueAt"
+	}
+
+	if f.Cursor != "" {
+		tok, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return ListResult{}, err
+		}
+		query["$or"] = []bson.M{
+			{sortField: bson.M{"$gt": tok.Value}},
+			{sortField: tok.Value, "_id": bson.M{"$gt": tok.ID}},
+		}
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Name: sortField, Value: 1}, {Name: "_id", Value: 1}}).
+		SetLimit(int64(limit) + 1)
+
+	cur, err := s.collection.Find(ctx, query, opts)
+	if err != nil {
+		return ListResult{}, err
+	}
+	defer cur.Close(ctx)
+
+	todos := []todoModel{}
+	for cur.Next(ctx) {
+		var t todoModel
+		if err := cur.Decode(&t); err != nil {
+			return ListResult{}, err
+		}
+		todos = append(todos, t)
+	}
+	if err := cur.Err(); err != nil {
+		return ListResult{}, err
+	}
+
+	nextCursor := ""
+	if len(todos) > limit {
+		last := todos[limit-1]
+		nextCursor = encodeCursor(cursorToken{ID: last.ID, Value: sortValue(last, sortField)})
+		todos = todos[:limit]
+	}
+
+	return ListResult{Todos: todos, NextCursor: nextCursor, Total: total}, nil
+}
+
+func (s *MongoStore) Get(ctx context.Context, ownerID, id string) (todoModel, error) {
+	var t todoModel
+	err := s.collection.FindOne(ctx, bson.M{"_id": id, "ownerId": ownerID}).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		return todoModel{}, ErrNotFound
+	}
+	return t, err
+}
+
+func (s *MongoStore) Create(ctx context.Context, t *todoModel) error {
+	if t.ID == "" {
+		t.ID = bson.NewObjectId().Hex()
+	}
+	t.Version = 1
+	_, err := s.collection.InsertOne(ctx, t)
+	return err
+}
+
+func (s *MongoStore) Update(ctx context.Context, ownerID, id string, t *todoModel, expectedVersion int) error {
+	filter := bson.M{"_id": id, "ownerId": ownerID}
+	if expectedVersion > 0 {
+		filter["version"] = expectedVersion
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"title":     t.Title,
+			"body":      t.Body,
+			"status":    t.Status,
+			"tags":      t.Tags,
+			"dueAt":     t.DueAt,
+			"updatedAt": t.UpdatedAt,
+		},
+		"$inc": bson.M{"version": 1},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated todoModel
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return s.notFoundOrConflict(ctx, ownerID, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	*t = updated
+	return nil
+}
+
+func (s *MongoStore) Delete(ctx context.Context, ownerID, id string, expectedVersion int) error {
+	filter := bson.M{"_id": id, "ownerId": ownerID}
+	if expectedVersion > 0 {
+		filter["version"] = expectedVersion
+	}
+
+	res, err := s.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return s.notFoundOrConflict(ctx, ownerID, id)
+	}
+	return nil
+}
+
+// notFoundOrConflict distinguishes a missing (or not-owned) todo from
+// one that exists but failed the version precondition, after a filtered
+// write matched zero documents.
+func (s *MongoStore) notFoundOrConflict(ctx context.Context, ownerID, id string) error {
+	if _, err := s.Get(ctx, ownerID, id); err == ErrNotFound {
+		return ErrNotFound
+	}
+	return ErrConflict
+}
+
+// Watch tails the collection's change stream so writes made by other
+// replicas or processes reach publish too, not just this process's own
+// handlers.
+func (s *MongoStore) Watch(ctx context.Context, publish func(changeEvent)) error {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	stream, err := s.collection.Watch(ctx, mongo.Pipeline{}, opts)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(ctx)
+
+	for stream.Next(ctx) {
+		var change struct {
+			OperationType string `bson:"operationType"`
+			DocumentKey   struct {
+				ID string `bson:"_id"`
+			} `bson:"documentKey"`
+			FullDocument todoModel `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&change); err != nil {
+			continue
+		}
+
+		var op string
+		switch change.OperationType {
+		case "insert":
+			op = "created"
+		case "update", "replace":
+			op = "updated"
+		case "delete":
+			op = "deleted"
+		default:
+			continue
+		}
+
+		t := toTodo(change.FullDocument)
+		publish(changeEvent{
+			Op:      op,
+			ID:      change.DocumentKey.ID,
+			OwnerID: change.FullDocument.OwnerID,
+			Todo:    &t,
+		})
+	}
+	return stream.Err()
+}
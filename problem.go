@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// problem is an RFC 7807 application/problem+json body.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+const problemBaseURI = "/problems/"
+
+// writeProblem writes an RFC 7807 problem+json response. problemClass is
+// the short error class (e.g. "validation", "not_found") and is
+// rendered as a stable URI under problemBaseURI, so clients can switch
+// on it without parsing prose.
+func writeProblem(w http.ResponseWriter, status int, problemClass, title, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem{
+		Type:   problemBaseURI + problemClass,
+		Title:  title,
+		Status: status,
+		Detail: detail,
+	})
+}
+
+// storeErrorProblem maps a TodoStore error to the matching problem
+// response. Context cancellation and deadline errors - the client went
+// away, or the backend didn't answer within dbOpTimeout - collapse into
+// "db_unavailable" rather than a generic 500.
+func storeErrorProblem(w http.ResponseWriter, err error) {
+	switch {
+	case err == ErrNotFound:
+		writeProblem(w, http.StatusNotFound, "not_found", "Todo not found", "")
+	case err == ErrConflict:
+		writeProblem(w, http.StatusPreconditionFailed, "conflict", "Todo has been modified since your last read", "")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		writeProblem(w, http.StatusServiceUnavailable, "db_unavailable", "The datastore did not respond in time", err.Error())
+	default:
+		writeProblem(w, http.StatusServiceUnavailable, "db_unavailable", "Failed to reach the datastore", err.Error())
+	}
+}
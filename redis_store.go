@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/go-redis/redis/v8"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const redisKeyPrefix = "todo:"
+
+// RedisStore is a TodoStore backed by plain Redis keys: each todo is
+// stored as a JSON blob under "todo:<id>", and List walks the keyspace
+// with SCAN rather than keeping a separate index.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore connects to the Redis instance at addr.
+func NewRedisStore(ctx context.Context, addr string) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: client}, nil
+}
+
+// newRedisBackedStore builds the RedisStore selected by TODO_STORE=redis,
+// optionally wrapping it with an event log per EVENT_LOG.
+func newRedisBackedStore(ctx context.Context) (TodoStore, error) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+
+	store, err := NewRedisStore(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	log, err := newEventLog(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if log == nil {
+		return store, nil
+	}
+
+	return NewEventSourcedStore(ctx, store, log)
+}
+
+func (s *RedisStore) key(id string) string {
+	return redisKeyPrefix + id
+}
+
+func (s *RedisStore) List(ctx context.Context, f TodoFilter) (ListResult, error) {
+	todos := []todoModel{}
+
+	var cursor uint64
+	for {
+		keys, next, err := s.client.Scan(ctx, cursor, redisKeyPrefix+"*", 100).Result()
+		if err != nil {
+			return ListResult{}, err
+		}
+
+		for _, key := range keys {
+			raw, err := s.client.Get(ctx, key).Bytes()
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				return ListResult{}, err
+			}
+			var t todoModel
+			if err := json.Unmarshal(raw, &t); err != nil {
+				return ListResult{}, err
+			}
+			todos = append(todos, t)
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return paginateTodos(filterTodos(todos, f), f), nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, ownerID, id string) (todoModel, error) {
+	raw, err := s.client.Get(ctx, s.key(id)).Bytes()
+	if err == redis.Nil {
+		return todoModel{}, ErrNotFound
+	}
+	if err != nil {
+		return todoModel{}, err
+	}
+
+	var t todoModel
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return todoModel{}, err
+	}
+	if t.OwnerID != ownerID {
+		return todoModel{}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (s *RedisStore) Create(ctx context.Context, t *todoModel) error {
+	if t.ID == "" {
+		t.ID = bson.NewObjectId().Hex()
+	}
+	t.Version = 1
+	return s.put(ctx, t)
+}
+
+func (s *RedisStore) Update(ctx context.Context, ownerID, id string, t *todoModel, expectedVersion int) error {
+	key := s.key(id)
+	return s.watchKey(ctx, key, func(tx *redis.Tx) error {
+		existing, err := s.getTx(ctx, tx, key, ownerID)
+		if err != nil {
+			return err
+		}
+		if expectedVersion > 0 && existing.Version != expectedVersion {
+			return ErrConflict
+		}
+
+		t.ID = id
+		t.OwnerID = ownerID
+		t.CreatedAt = existing.CreatedAt
+		t.Version = existing.Version + 1
+
+		raw, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, raw, 0)
+			return nil
+		})
+		return err
+	})
+}
+
+func (s *RedisStore) Delete(ctx context.Context, ownerID, id string, expectedVersion int) error {
+	key := s.key(id)
+	return s.watchKey(ctx, key, func(tx *redis.Tx) error {
+		existing, err := s.getTx(ctx, tx, key, ownerID)
+		if err != nil {
+			return err
+		}
+		if expectedVersion > 0 && existing.Version != expectedVersion {
+			return ErrConflict
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			return nil
+		})
+		return err
+	})
+}
+
+// getTx reads and decodes the todo at key within an in-flight WATCH
+// transaction, so the caller's conflict check sees a value that can't
+// change again before the transaction commits.
+func (s *RedisStore) getTx(ctx context.Context, tx *redis.Tx, key, ownerID string) (todoModel, error) {
+	raw, err := tx.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return todoModel{}, ErrNotFound
+	}
+	if err != nil {
+		return todoModel{}, err
+	}
+
+	var t todoModel
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return todoModel{}, err
+	}
+	if t.OwnerID != ownerID {
+		return todoModel{}, ErrNotFound
+	}
+	return t, nil
+}
+
+// maxOptimisticRetries bounds how many times in all watchKey attempts a
+// transaction (the first try included) while it keeps losing the
+// optimistic lock to a concurrent writer, before giving up and reporting
+// it as a version conflict.
+const maxOptimisticRetries = 5
+
+// watchKey runs fn as a WATCH/MULTI/EXEC transaction on key, so the
+// read-check-write done by Update/Delete is atomic: if another client
+// modifies key between fn's read and its EXEC, Redis aborts the
+// transaction and watchKey retries rather than silently clobbering the
+// concurrent write.
+func (s *RedisStore) watchKey(ctx context.Context, key string, fn func(tx *redis.Tx) error) error {
+	for i := 0; i < maxOptimisticRetries; i++ {
+		err := s.client.Watch(ctx, fn, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return ErrConflict
+}
+
+func (s *RedisStore) put(ctx context.Context, t *todoModel) error {
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.key(t.ID), raw, 0).Err()
+}
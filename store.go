@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by a TodoStore when no todo matches the given id.
+var ErrNotFound = errors.New("todo: not found")
+
+// ErrConflict is returned by Update/Delete when the caller's expected
+// version doesn't match the current one (optimistic concurrency).
+var ErrConflict = errors.New("todo: version conflict")
+
+// TodoFilter narrows a List call. A zero-value TodoFilter matches every
+// todo, sorted by createdAt, with the default page size.
+type TodoFilter struct {
+	OwnerID   string
+	Completed *bool
+	Tag       string
+	Query     string
+	DueBefore *time.Time
+	Sort      string // "createdAt" (default) or "dueAt"
+	Limit     int
+	Cursor    string
+}
+
+// ListResult is the page of todos returned by List, along with the
+// opaque cursor to fetch the next page (empty once exhausted) and the
+// total count of todos matching the filter.
+type ListResult struct {
+	Todos      []todoModel
+	NextCursor string
+	Total      int64
+}
+
+const defaultPageSize = 20
+
+// defaultDBOpTimeout bounds how long a single store call may run once a
+// request's own deadline (if any) has been applied. DB_OP_TIMEOUT
+// overrides it, e.g. for slower networks or local debugging.
+const defaultDBOpTimeout = 5 * time.Second
+
+func dbOpTimeout() time.Duration {
+	if v := os.Getenv("DB_OP_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return defaultDBOpTimeout
+}
+
+// TodoStore is the storage-agnostic interface the HTTP handlers talk to.
+// Every backend (Mongo, Redis, in-memory, ...) implements this so the
+// handlers never need to know which database is behind them.
+//
+// Get, Update and Delete are scoped by ownerID: they must behave as if
+// the todo didn't exist when it belongs to a different owner, so a
+// caller can never probe for or affect another user's todos.
+//
+// Update and Delete take expectedVersion for optimistic concurrency: a
+// positive value must match the stored todo's current Version or the
+// call fails with ErrConflict. A value of 0 skips the check, for
+// internal callers (event replay) that don't go through If-Match.
+type TodoStore interface {
+	List(ctx context.Context, f TodoFilter) (ListResult, error)
+	Get(ctx context.Context, ownerID, id string) (todoModel, error)
+	Create(ctx context.Context, t *todoModel) error
+	Update(ctx context.Context, ownerID, id string, t *todoModel, expectedVersion int) error
+	Delete(ctx context.Context, ownerID, id string, expectedVersion int) error
+}
+
+// newStore builds the TodoStore selected by the TODO_STORE env var
+// (mongo, redis or memory). It defaults to mongo to preserve the
+// historical behaviour of this service.
+func newStore(ctx context.Context) (TodoStore, error) {
+	switch os.Getenv("TODO_STORE") {
+	case "redis":
+		return newRedisBackedStore(ctx)
+	case "memory":
+		return NewMemoryStore(), nil
+	case "", "mongo":
+		return NewMongoStore(ctx, mongoURI())
+	default:
+		return nil, errors.New("store: unknown TODO_STORE backend " + os.Getenv("TODO_STORE"))
+	}
+}
+
+func mongoURI() string {
+	if uri := os.Getenv("MONGO_URI"); uri != "" {
+		return uri
+	}
+	return "mongodb://" + hostName
+}
+
+// cursorToken is the decoded form of an opaque pagination cursor: the
+// value of the sort field and the _id of the last todo on the previous
+// page, used together to break ties deterministically.
+type cursorToken struct {
+	ID    string    `json:"id"`
+	Value time.Time `json:"v"`
+}
+
+func encodeCursor(t cursorToken) string {
+	raw, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (cursorToken, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursorToken{}, err
+	}
+	var t cursorToken
+	err = json.Unmarshal(raw, &t)
+	return t, err
+}
+
+// sortValue returns the field a todo is ordered by for the given sort key.
+func sortValue(t todoModel, sortKey string) time.Time {
+	if sortKey == "dueAt" && t.DueAt != nil {
+		return *t.DueAt
+	}
+	return t.CreatedAt
+}
+
+// filterTodos and paginateTodos implement TodoFilter in plain Go, shared
+// by stores (Redis, memory) that have no native query support.
+func filterTodos(todos []todoModel, f TodoFilter) []todoModel {
+	out := todos[:0:0]
+	for _, t := range todos {
+		if f.OwnerID != "" && t.OwnerID != f.OwnerID {
+			continue
+		}
+		if f.Completed != nil && (t.Status == StatusDone) != *f.Completed {
+			continue
+		}
+		if f.Tag != "" && !hasTag(t.Tags, f.Tag) {
+			continue
+		}
+		if f.Query != "" && !strings.Contains(strings.ToLower(t.Title), strings.ToLower(f.Query)) {
+			continue
+		}
+		if f.DueBefore != nil && (t.DueAt == nil || !t.DueAt.Before(*f.DueBefore)) {
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+func paginateTodos(todos []todoModel, f TodoFilter) ListResult {
+	sortKey := f.Sort
+	if sortKey != "dueAt" {
+		sortKey = "createdAt"
+	}
+
+	sort.Slice(todos, func(i, j int) bool {
+		vi, vj := sortValue(todos[i], sortKey), sortValue(todos[j], sortKey)
+		if vi.Equal(vj) {
+			return todos[i].ID < todos[j].ID
+		}
+		return vi.Before(vj)
+	})
+
+	total := int64(len(todos))
+
+	if f.Cursor != "" {
+		tok, err := decodeCursor(f.Cursor)
+		if err == nil {
+			start := 0
+			for start < len(todos) {
+				v := sortValue(todos[start], sortKey)
+				if v.After(tok.Value) || (v.Equal(tok.Value) && todos[start].ID > tok.ID) {
+					break
+				}
+				start++
+			}
+			todos = todos[start:]
+		}
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+
+	nextCursor := ""
+	if len(todos) > limit {
+		last := todos[limit-1]
+		nextCursor = encodeCursor(cursorToken{ID: last.ID, Value: sortValue(last, sortKey)})
+		todos = todos[:limit]
+	}
+
+	return ListResult{Todos: todos, NextCursor: nextCursor, Total: total}
+}
+
+// computeETag turns a todo's version into a quoted strong ETag value.
+func computeETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseETag parses the version out of a quoted ETag value, as sent back
+// by clients in an If-Match header. Versions are always positive (they
+// start at 1), so anything <= 0 is rejected rather than silently
+// passed through as expectedVersion == 0, the stores' internal
+// escape hatch that skips the version check entirely.
+func parseETag(etag string) (int, error) {
+	version, err := strconv.Atoi(strings.Trim(etag, `"`))
+	if err != nil {
+		return 0, err
+	}
+	if version <= 0 {
+		return 0, errors.New("store: ETag version must be positive")
+	}
+	return version, nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// changeEvent describes one successful write, fanned out to anyone
+// streaming changes for that todo's owner.
+type changeEvent struct {
+	Op      string `json:"op"` // "created", "updated" or "deleted"
+	ID      string `json:"id"`
+	OwnerID string `json:"-"`
+	Todo    *todo  `json:"todo,omitempty"`
+}
+
+// Broker fans changeEvents out to subscribers. Each subscriber gets its
+// own buffered channel; a subscriber that isn't draining fast enough
+// has events dropped rather than blocking the publisher.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[chan changeEvent]struct{}
+}
+
+var broker = &Broker{subs: make(map[chan changeEvent]struct{})}
+
+func (b *Broker) Subscribe() chan changeEvent {
+	ch := make(chan changeEvent, 16)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *Broker) Unsubscribe(ch chan changeEvent) {
+	b.mu.Lock()
+	delete(b.subs, ch)
+	close(ch)
+	b.mu.Unlock()
+}
+
+func (b *Broker) Publish(e changeEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			// Slow consumer: drop the event instead of blocking everyone else.
+		}
+	}
+}
+
+// Watchable is implemented by stores that can tail changes made by
+// other processes/replicas, so those are fanned out too.
+type Watchable interface {
+	Watch(ctx context.Context, publish func(changeEvent)) error
+}
+
+// streamMessage is the envelope sent down both the SSE and WebSocket
+// streams: a snapshot of the first page (at most defaultPageSize) of
+// existing todos, then a "live" marker, then one
+// message per change event from then on.
+type streamMessage struct {
+	Type  string       `json:"type"` // "snapshot", "live" or "event"
+	Todos []todo       `json:"todos,omitempty"`
+	Event *changeEvent `json:"event,omitempty"`
+}
+
+func snapshotTodos(ctx context.Context, ownerID string) ([]todo, error) {
+	res, err := store.List(ctx, TodoFilter{OwnerID: ownerID, Limit: defaultPageSize})
+	if err != nil {
+		return nil, err
+	}
+	todos := make([]todo, 0, len(res.Todos))
+	for _, t := range res.Todos {
+		todos = append(todos, toTodo(t))
+	}
+	return todos, nil
+}
+
+// sseHandler implements GET /todo/stream: a snapshot of the caller's
+// todos (the first page only, at most defaultPageSize of them by
+// createdAt), a "live" marker, then one SSE message per subsequent change.
+func sseHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeProblem(w, http.StatusInternalServerError, "internal", "Streaming unsupported", "")
+		return
+	}
+
+	ownerID := userIDFromContext(r.Context())
+
+	snapshotCtx, cancel := context.WithTimeout(r.Context(), dbOpTimeout())
+	todos, err := snapshotTodos(snapshotCtx, ownerID)
+	cancel()
+	if err != nil {
+		storeErrorProblem(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	writeSSE(w, streamMessage{Type: "snapshot", Todos: todos})
+	writeSSE(w, streamMessage{Type: "live"})
+	flusher.Flush()
+
+	ch := broker.Subscribe()
+	defer broker.Unsubscribe(ch)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-ch:
+			if e.OwnerID != ownerID {
+				continue
+			}
+			writeSSE(w, streamMessage{Type: "event", Event: &e})
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, msg streamMessage) {
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", raw)
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsHandler is the WebSocket equivalent of sseHandler, for clients that
+// prefer a persistent bidirectional connection over SSE.
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	ownerID := userIDFromContext(r.Context())
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("ws upgrade: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	snapshotCtx, cancel := context.WithTimeout(r.Context(), dbOpTimeout())
+	todos, err := snapshotTodos(snapshotCtx, ownerID)
+	cancel()
+	if err != nil {
+		return
+	}
+	if err := conn.WriteJSON(streamMessage{Type: "snapshot", Todos: todos}); err != nil {
+		return
+	}
+	if err := conn.WriteJSON(streamMessage{Type: "live"}); err != nil {
+		return
+	}
+
+	ch := broker.Subscribe()
+	defer broker.Unsubscribe(ch)
+
+	// gorilla/websocket requires the application to keep reading so
+	// control frames are handled and a peer that vanishes without a
+	// clean close frame is noticed; this connection is otherwise
+	// write-only, so the pump's only job is to detect that and signal
+	// the write loop below to stop (and unsubscribe).
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case e := <-ch:
+			if e.OwnerID != ownerID {
+				continue
+			}
+			if err := conn.WriteJSON(streamMessage{Type: "event", Event: &e}); err != nil {
+				return
+			}
+		}
+	}
+}